@@ -0,0 +1,1125 @@
+// Package app implements the hello command, independently of the process it
+// runs in.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"libA"
+)
+
+// Version identifies this build of hello; override it with
+// -ldflags "-X hello/app.Version=...".
+var Version = "dev"
+
+// stdin is where a negative -n reads the count from, and -from-stdin the
+// names to greet.
+var stdin io.Reader = os.Stdin
+
+// stringList is a flag.Value that collects every occurrence of a repeated
+// flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// options holds the settings that control what hello prints.
+type options struct {
+	messages   []string
+	count      int
+	name       string
+	names      []string
+	greeting   string
+	greeter    libA.Greeter
+	quiet      bool
+	delay      time.Duration
+	format     string
+	upper      bool
+	prefix     string
+	workers    int
+	tmpl       *template.Template
+	countFrom  int
+	repeat     int
+	color      string
+	timestamp  string
+	separator  string
+	log        *slog.Logger
+	reverse    bool
+	buffered   bool
+	perName    bool
+	speakEvery int
+	// input, if non-nil, has a name per line to greet instead of messages.
+	input io.Reader
+}
+
+// plain reports whether o prints a single message with every line exactly
+// alike, which lets the messages be written through libA.GreetN.
+func (o options) plain() bool {
+	return len(o.messages) == 1 && o.tmpl == nil && o.repeat == 1 && o.delay == 0 &&
+		o.separator == "\n" && !o.upper && o.prefix == "" && o.color == "" && o.timestamp == ""
+}
+
+// iterations returns the number of iterations that print anything: o.count,
+// or none if there are no messages to print.
+func (o options) iterations() int {
+	if o.tmpl == nil && len(o.messages) == 0 {
+		return 0
+	}
+	return o.count
+}
+
+// templateData is what a -template is executed against for each iteration.
+type templateData struct {
+	Index int
+	Total int
+}
+
+// iteration returns the messages to print for the i'th of the 0-based
+// iterations, which run in descending order if o.reverse is set.
+func (o options) iteration(i int) ([]string, error) {
+	if o.reverse {
+		i = o.count - 1 - i
+	}
+	msgs := o.messages
+	if o.tmpl != nil {
+		var buf bytes.Buffer
+		if err := o.tmpl.Execute(&buf, templateData{Index: o.countFrom + i, Total: o.count}); err != nil {
+			return nil, err
+		}
+		msgs = []string{buf.String()}
+	}
+	if o.repeat == 1 {
+		return msgs, nil
+	}
+	repeated := make([]string, len(msgs))
+	for j, msg := range msgs {
+		repeated[j] = o.repeated(msg)
+	}
+	return repeated, nil
+}
+
+// repeated returns msg repeated o.repeat times, separated by spaces.
+func (o options) repeated(msg string) string {
+	words := make([]string, o.repeat)
+	for i := range words {
+		words[i] = msg
+	}
+	return strings.Join(words, " ")
+}
+
+// plan describes what printing according to o would do, without doing it.
+func (o options) plan() string {
+	var plan string
+	switch {
+	case o.input != nil:
+		plan = fmt.Sprintf("would greet each line of stdin %d time(s)", o.count)
+	case o.tmpl != nil:
+		plan = fmt.Sprintf("would print %d line(s) of template %q", o.count, o.tmpl.Root.String())
+	case len(o.messages) == 0:
+		plan = "would print 0 line(s)"
+	default:
+		quoted := make([]string, len(o.messages))
+		for i, msg := range o.messages {
+			quoted[i] = strconv.Quote(msg)
+		}
+		plan = fmt.Sprintf("would print %s line(s) of %s", times(o.count, len(o.messages)), strings.Join(quoted, ", "))
+	}
+	switch {
+	case o.quiet:
+	case len(o.names) > 0:
+		plan += fmt.Sprintf(" and %s name greeting(s)", times(o.count, len(o.names)))
+	default:
+		plan += " and 1 libA greeting"
+	}
+	return plan
+}
+
+// times formats the non-negative product n*m, saying only that it is more than
+// math.MaxInt if it overflows.
+func times(n, m int) string {
+	if m != 0 && n > math.MaxInt/m {
+		return fmt.Sprintf("more than %d", math.MaxInt)
+	}
+	return strconv.Itoa(n * m)
+}
+
+// decorate applies the per-line transformations selected by o to line.
+func (o options) decorate(line string) string {
+	if o.upper {
+		line = strings.ToUpper(line)
+	}
+	if o.prefix != "" {
+		line = o.prefix + " " + line
+	}
+	if o.timestamp != "" {
+		line = time.Now().Format(o.timestamp) + " " + line
+	}
+	if o.color != "" {
+		line = o.color + line + colorReset
+	}
+	return line
+}
+
+// colors maps the names accepted by -color to their ANSI escape codes.
+var colors = map[string]string{
+	"red":     "\x1b[31m",
+	"green":   "\x1b[32m",
+	"yellow":  "\x1b[33m",
+	"blue":    "\x1b[34m",
+	"magenta": "\x1b[35m",
+	"cyan":    "\x1b[36m",
+}
+
+const colorReset = "\x1b[0m"
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+const usageExamples = `
+Examples:
+  hello -n 3
+  hello -message Hi -uppercase
+  hello -n 5 -template "{{.Index}}/{{.Total}}: hi" -quiet
+`
+
+// Run runs hello with the command line arguments args, which exclude the
+// program name, and returns the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("hello", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of hello:")
+		fs.PrintDefaults()
+		fmt.Fprint(fs.Output(), usageExamples)
+	}
+	n := fs.String("n", "1", "print message n times, or a random number of times within an inclusive MIN-MAX range; if negative, read the count from stdin; $HELLO_COUNT overrides the default")
+	var messages stringList
+	fs.Var(&messages, "message", "message to print; may be repeated (default $HELLO_MESSAGE, or \"Hello, world!\" if unset)")
+	name := fs.String("name", "", "greet name instead of the default libA speech")
+	greeting := fs.String("greeting", "", "greet with this word, in place of \"Hello\", instead of the default libA speech")
+	quiet := fs.Bool("quiet", false, "skip the libA speech; with -n 0 nothing is printed at all")
+	out := fs.String("out", "", "write the messages to this file instead of stdout")
+	delay := fs.Duration("delay", 0, "pause this long between messages")
+	format := fs.String("format", "text", "output format: text or json")
+	uppercase := fs.Bool("uppercase", false, "print messages and the libA speech in upper case")
+	requireOutput := fs.Bool("require-output", false, "fail if the effective message count is 0")
+	version := fs.Bool("version", false, "print the version and exit")
+	prefix := fs.String("prefix", "", "label every printed line with this prefix")
+	workers := fs.Int("workers", 1, "split the messages across this many goroutines; with more than 1, line order is non-deterministic")
+	summary := fs.Bool("summary", false, "report how many messages were printed on stderr")
+	tmplText := fs.String("template", "", "print this text/template once per iteration instead of the messages; it may use {{.Index}} and {{.Total}}")
+	seed := fs.Int64("seed", 0, "seed for choosing a count from a -n range (default: based on the current time)")
+	greeterName := fs.String("greeter", libA.DefaultGreeter, "name of the registered libA greeter that gives the speech")
+	toStderr := fs.Bool("stderr", false, "print to stderr instead of stdout")
+	countFrom := fs.Int("count-from", 1, "index of the first iteration, as seen by -template's {{.Index}}")
+	repeat := fs.Int("repeat-message", 1, "repeat each message this many times on its line, separated by spaces")
+	color := fs.String("color", "", "print lines in this color: red, green, yellow, blue, magenta or cyan; ignored unless printing to a terminal")
+	forceColor := fs.Bool("force-color", false, "use -color even when not printing to a terminal")
+	names := fs.String("names", "", "comma-separated names to greet, one per line and n times over, instead of the default libA speech")
+	perName := fs.Bool("per-name", false, "with -names, greet each name n times in a row rather than cycling through the list n times")
+	messageFile := fs.String("message-file", "", "print each line of this file as a message, cycling through the whole file n times; conflicts with -message")
+	dryRun := fs.Bool("dry-run", false, "describe what would be printed on stderr instead of printing it")
+	timestamp := fs.Bool("timestamp", false, "start every printed line with the current time")
+	timeFormat := fs.String("time-format", time.RFC3339, "layout of -timestamp's times, as for time.Format")
+	maxRuntime := fs.Duration("max-runtime", 0, "stop printing messages after this long and exit successfully (default: no limit)")
+	fail := fs.Int("fail", 0, "exit with this code once everything has been printed, to exercise failure handling")
+	separator := fs.String("separator", `\n`, "text printed between lines, with Go escape sequences such as \\t interpreted")
+	logLevel := fs.String("log-level", "warn", "log internal events on stderr at this level or above: debug, info, warn or error")
+	reverse := fs.Bool("reverse", false, "run the iterations from last to first; only visible with -template")
+	buffered := fs.Bool("buffered", false, "batch output in memory and write it all at the end")
+	countBytes := fs.Bool("count-bytes", false, "report how many bytes were printed on stderr")
+	speakEvery := fs.Int("speak-every", 0, "give the libA speech after every this many messages too, not only at the end, writing it wherever the messages go; each speech then greets -names only once")
+	fromStdin := fs.Bool("from-stdin", false, "instead of the messages, greet each line of stdin n times in a row")
+	configPath := fs.String("config", "", "read flag values from this JSON file, keyed by flag name; flags given on the command line take precedence")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if *version {
+		fmt.Fprintf(stdout, "hello %s (%s)\n", Version, runtime.Version())
+		return 0
+	}
+	if *configPath != "" {
+		if err := applyConfig(fs, *configPath); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintf(stderr, "unknown log level %q\n", *logLevel)
+		return 2
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	logger.Info("parsed flags", "args", args)
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q: must be text or json\n", *format)
+		return 2
+	}
+	if _, ok := colors[*color]; *color != "" && !ok {
+		fmt.Fprintf(stderr, "unknown color %q\n", *color)
+		return 2
+	}
+	sep, err := unescape(*separator)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid separator %q\n", *separator)
+		return 2
+	}
+	if *speakEvery < 0 {
+		fmt.Fprintf(stderr, "speak-every must not be negative, got %d\n", *speakEvery)
+		return 2
+	}
+	if *workers < 1 {
+		fmt.Fprintf(stderr, "workers must be at least 1, got %d\n", *workers)
+		return 2
+	}
+	if *repeat < 0 {
+		fmt.Fprintf(stderr, "repeat-message must not be negative, got %d\n", *repeat)
+		return 2
+	}
+	if *messageFile != "" {
+		if len(messages) > 0 {
+			fmt.Fprintln(stderr, "-message and -message-file are mutually exclusive")
+			return 2
+		}
+		lines, err := readLines(*messageFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		messages = lines
+	}
+	if len(messages) == 0 && *messageFile == "" {
+		if env, ok := os.LookupEnv("HELLO_MESSAGE"); ok {
+			messages = stringList{env}
+		} else {
+			messages = stringList{"Hello, world!"}
+		}
+	}
+	if env, ok := os.LookupEnv("HELLO_COUNT"); ok && !set["n"] {
+		*n = env
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	count, err := parseCount(*n, rand.New(rand.NewSource(*seed)))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if count < 0 && *fromStdin {
+		fmt.Fprintln(stderr, "a negative -n cannot be combined with -from-stdin")
+		return 2
+	}
+	if count < 0 {
+		if count, err = readCount(stdin); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	if count == 0 && *requireOutput {
+		fmt.Fprintln(stderr, "message count is 0 but -require-output is set")
+		return 2
+	}
+	var tmpl *template.Template
+	if *tmplText != "" {
+		var err error
+		if tmpl, err = template.New("message").Parse(*tmplText); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	greeter, err := libA.Lookup(*greeterName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	opts := options{
+		messages:   messages,
+		count:      count,
+		name:       *name,
+		greeting:   *greeting,
+		quiet:      *quiet,
+		delay:      *delay,
+		format:     *format,
+		upper:      *uppercase,
+		prefix:     *prefix,
+		workers:    *workers,
+		tmpl:       tmpl,
+		greeter:    greeter,
+		countFrom:  *countFrom,
+		repeat:     *repeat,
+		separator:  sep,
+		log:        logger,
+		reverse:    *reverse,
+		buffered:   *buffered,
+		perName:    *perName,
+		speakEvery: *speakEvery,
+	}
+	if *fromStdin {
+		opts.input = stdin
+	}
+	for _, name := range strings.Split(*names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.names = append(opts.names, name)
+		}
+	}
+	if *timestamp {
+		opts.timestamp = *timeFormat
+	}
+	logger.Debug("resolved options", "messages", opts.messages, "count", opts.count, "greeter", *greeterName)
+	if *dryRun {
+		fmt.Fprintln(stderr, opts.plan())
+		return *fail
+	}
+	console := stdout
+	if *toStderr {
+		console = stderr
+	}
+	if *format == "text" && (*forceColor || *out == "" && isTerminal(console)) {
+		opts.color = colors[*color]
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxRuntime)
+		defer cancel()
+	}
+	var counters []*countingWriter
+	counted := func(w io.Writer) io.Writer {
+		if !*countBytes {
+			return w
+		}
+		cw := &countingWriter{w: w}
+		counters = append(counters, cw)
+		return cw
+	}
+	console = counted(console)
+	w := console
+	var f *os.File
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		w = counted(f)
+	}
+	printed, err := emitBuffered(ctx, w, console, opts)
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(stderr, "interrupted")
+		return 130
+	}
+	if errors.Is(err, syscall.EPIPE) {
+		// Whoever was reading the output has gone away, e.g. `hello | head`.
+		return 0
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(stderr, "max runtime reached after %d line(s)\n", printed)
+		err = nil
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if *summary {
+		fmt.Fprintf(stderr, "Printed %d greeting(s).\n", printed)
+	}
+	if *countBytes {
+		var written int64
+		for _, cw := range counters {
+			written += cw.Written()
+		}
+		fmt.Fprintf(stderr, "wrote %d bytes\n", written)
+	}
+	return *fail
+}
+
+// applyConfig sets the flags in fs that were not given on the command line
+// from the JSON object in the file at path, whose keys are flag names. A flag
+// that may be repeated takes a JSON array.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var config map[string]interface{}
+	if err := dec.Decode(&config); err != nil {
+		return fmt.Errorf("parsing config %s: %v", path, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("parsing config %s: unexpected data after the top-level object", path)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, value := range config {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("parsing config %s: unknown key %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		} else if _, repeated := fs.Lookup(name).Value.(*stringList); !repeated {
+			return fmt.Errorf("parsing config %s: %q does not take a list", path, name)
+		}
+		for _, v := range values {
+			var arg string
+			switch v := v.(type) {
+			case string:
+				arg = v
+			case json.Number:
+				arg = v.String()
+			case bool:
+				arg = strconv.FormatBool(v)
+			default:
+				return fmt.Errorf("parsing config %s: invalid value for %q: %v", path, name, v)
+			}
+			if err := fs.Set(name, arg); err != nil {
+				return fmt.Errorf("parsing config %s: invalid value for %q: %v", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// countingWriter is an io.Writer that counts the bytes written through it.
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+// Written returns the number of bytes written so far.
+func (c *countingWriter) Written() int64 {
+	return c.written
+}
+
+// emitBuffered is like emit, but if opts.buffered is set it batches the writes
+// to w and console, flushing them at the end even if emit fails. It returns
+// the number of messages printed, stopping early if ctx is done.
+func emitBuffered(ctx context.Context, w, console io.Writer, opts options) (int, error) {
+	if !opts.buffered {
+		return emit(ctx, w, console, opts)
+	}
+	bw := bufio.NewWriter(w)
+	bconsole := bw
+	if console != w {
+		bconsole = bufio.NewWriter(console)
+	}
+	printed, err := emit(ctx, bw, bconsole, opts)
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	if bconsole != bw {
+		if ferr := bconsole.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return printed, err
+}
+
+// emit writes the messages to w in the format selected by opts, returning how
+// many were written. In text mode the libA speech goes to console at the end,
+// unless opts.speakEvery is set, in which case it goes to w along with the
+// messages, after every opts.speakEvery of them and at the end, and greets
+// opts.names just once each time; in json mode it ends the array.
+func emit(ctx context.Context, w, console io.Writer, opts options) (int, error) {
+	if opts.format == "json" {
+		return writeJSON(ctx, w, opts)
+	}
+	lw := &lineWriter{w: w, sep: opts.separator}
+	speechWriter := lw
+	if console != w && opts.speakEvery == 0 {
+		speechWriter = &lineWriter{w: console, sep: opts.separator}
+	}
+	speechOpts := opts
+	var afterLine func() error
+	if opts.speakEvery > 0 {
+		// Greeting the names opts.count times in every speech would make the
+		// output grow with the square of the count.
+		speechOpts.count = 1
+		var mu sync.Mutex
+		written := 0
+		afterLine = func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			if written++; written%opts.speakEvery != 0 {
+				return nil
+			}
+			return writeSpeech(ctx, speechWriter.writeLine, speechOpts)
+		}
+	}
+	opts.log.Info("starting loop", "count", opts.count, "workers", opts.workers)
+	printed, err := writeGreetings(ctx, lw, opts, afterLine)
+	if err == nil {
+		opts.log.Info("loop complete", "printed", printed)
+		// Don't repeat the speech if one was just given after the last message.
+		if opts.speakEvery == 0 || printed == 0 || printed%opts.speakEvery != 0 {
+			err = writeSpeech(ctx, speechWriter.writeLine, speechOpts)
+		}
+	}
+	// End the last line even if printing stopped early.
+	if ferr := lw.finish(); err == nil {
+		err = ferr
+	}
+	if speechWriter != lw {
+		if ferr := speechWriter.finish(); err == nil {
+			err = ferr
+		}
+	}
+	return printed, err
+}
+
+// writeSpeech passes each decorated line of the libA speech selected by opts
+// to writeLine as soon as it is given, stopping with ctx.Err() once ctx is
+// done.
+func writeSpeech(ctx context.Context, writeLine func(line string) error, opts options) error {
+	if opts.quiet {
+		return nil
+	}
+	w := &lineSplitter{fn: func(line string) error {
+		return writeLine(opts.decorate(line))
+	}}
+	var err error
+	if len(opts.names) > 0 {
+		err = speakNames(ctx, w, opts)
+	} else if opts.name != "" {
+		c := libA.DefaultConfig()
+		c.Writer = w
+		c.Name = opts.name
+		if opts.greeting != "" {
+			c.Word = opts.greeting
+		}
+		err = c.Speak()
+	} else if opts.greeting != "" {
+		err = libA.SpeakWord(w, opts.greeting)
+	} else {
+		err = opts.greeter.Greet(w)
+	}
+	if err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+// speakNames greets the names in opts to w, repeated opts.count times: each
+// name in turn if opts.perName is set (a, a, b, b), or else the whole list
+// over again (a, b, a, b). It stops with ctx.Err() once ctx is done.
+func speakNames(ctx context.Context, w io.Writer, opts options) error {
+	if opts.perName {
+		for _, name := range opts.names {
+			for i := 0; i < opts.count; i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := libA.SpeakTo(w, name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for i := 0; i < opts.count; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := libA.SpeakAll(w, opts.names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineSplitter is an io.Writer that passes each line written to it, without
+// its newline, to fn as soon as the line is complete.
+type lineSplitter struct {
+	fn  func(line string) error
+	buf []byte
+}
+
+func (s *lineSplitter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(s.buf[:i])
+		s.buf = s.buf[i+1:]
+		if err := s.fn(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// flush passes on the last line written if it was left without a newline.
+func (s *lineSplitter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	line := string(s.buf)
+	s.buf = nil
+	return s.fn(line)
+}
+
+// writeJSON writes the messages, or the greetings for the names in
+// opts.input, followed by the lines of the libA speech, to w as a single JSON
+// array of strings, one element at a time. It returns the number of messages
+// in the array. Once ctx is done it stops adding lines and ends the array
+// early, returning ctx.Err().
+func writeJSON(ctx context.Context, w io.Writer, opts options) (int, error) {
+	arr := &jsonArray{w: w}
+	printed := 0
+	writeMessage := func(msg string) error {
+		if err := arr.writeLine(opts.decorate(msg)); err != nil {
+			return err
+		}
+		printed++
+		return nil
+	}
+	var err error
+	if opts.input != nil {
+		err = eachStdinGreeting(ctx, opts.input, opts.log, func(greeting string) error {
+			for i := 0; i < opts.count; i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := writeMessage(opts.repeated(greeting)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	} else {
+		for i := 0; i < opts.iterations() && err == nil; i++ {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			var msgs []string
+			if msgs, err = opts.iteration(i); err != nil {
+				break
+			}
+			for _, msg := range msgs {
+				if err = writeMessage(msg); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err == nil {
+		err = writeSpeech(ctx, arr.writeLine, opts)
+	}
+	// Stopping early still ends the array, so the output stays valid JSON.
+	if ferr := arr.finish(); err == nil {
+		err = ferr
+	}
+	return printed, err
+}
+
+// jsonArray writes a JSON array of strings to an underlying io.Writer an
+// element at a time, so that the array is never held in memory whole.
+type jsonArray struct {
+	w       io.Writer
+	started bool
+}
+
+func (a *jsonArray) writeLine(line string) error {
+	elem, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	open := ","
+	if !a.started {
+		open = "["
+	}
+	a.started = true
+	_, err = io.WriteString(a.w, open+string(elem))
+	return err
+}
+
+// finish closes the array, which is empty if nothing was written.
+func (a *jsonArray) finish() error {
+	end := "]\n"
+	if !a.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(a.w, end)
+	return err
+}
+
+// parseCount parses the value of -n, which is either an integer or an
+// inclusive MIN-MAX range from which a count is picked using rng.
+func parseCount(s string, rng *rand.Rand) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid count %q: must be an integer or a MIN-MAX range", s)
+	}
+	min, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q: must be an integer or a MIN-MAX range", s)
+	}
+	max, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q: must be an integer or a MIN-MAX range", s)
+	}
+	if min < 0 || min > max {
+		return 0, fmt.Errorf("invalid count range %q: must satisfy 0 <= MIN <= MAX", s)
+	}
+	if max-min == math.MaxInt {
+		return 0, fmt.Errorf("invalid count range %q: too wide", s)
+	}
+	return min + rng.Intn(max-min+1), nil
+}
+
+// eachStdinGreeting reads names from r, one per line, and calls fn with the
+// libA greeting for each of them as soon as it is read, stopping at the first
+// error. Blank lines are skipped. It stops with ctx.Err() once ctx is done,
+// even while waiting for a line; r is read in a goroutine, which is left
+// blocked in its read until r has more data or is closed.
+func eachStdinGreeting(ctx context.Context, r io.Reader, logger *slog.Logger, fn func(greeting string) error) error {
+	names := make(chan string)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(names)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case names <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+	for line := 1; ; line++ {
+		var name string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case name, ok = <-names:
+		}
+		if !ok {
+			break
+		}
+		if strings.TrimSpace(name) == "" {
+			logger.Debug("skipping empty stdin line", "line", line)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := libA.SpeakTo(&buf, name); err != nil {
+			return err
+		}
+		if err := fn(strings.TrimSuffix(buf.String(), "\n")); err != nil {
+			return err
+		}
+	}
+	if err := <-readErr; err != nil {
+		return fmt.Errorf("reading stdin: %v", err)
+	}
+	return nil
+}
+
+// unescape interprets the Go escape sequences in s, such as \t or \x00, as in
+// a double-quoted string literal, except that a " or a trailing \ stands for
+// itself.
+func unescape(s string) (string, error) {
+	var b strings.Builder
+	for len(s) > 0 {
+		if s[0] == '"' || s == `\` {
+			b.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+		r, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return "", err
+		}
+		if multibyte {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(byte(r))
+		}
+		s = tail
+	}
+	return b.String(), nil
+}
+
+// readLines returns the lines of the file at path, including blank ones.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return lines, nil
+}
+
+// readCount reads a single non-negative repeat count from r.
+func readCount(r io.Reader) (int, error) {
+	var n int
+	if _, err := fmt.Fscan(r, &n); err != nil {
+		return 0, fmt.Errorf("reading count from stdin: %v", err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("count from stdin must be non-negative, got %d", n)
+	}
+	return n, nil
+}
+
+// lineWriter writes lines to an underlying io.Writer with sep between them,
+// ending the output with a newline once finished. It is safe for concurrent
+// use, and lines written concurrently are never interleaved.
+type lineWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	sep     string
+	started bool
+}
+
+func (l *lineWriter) writeLine(line string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.started {
+		line = l.sep + line
+	}
+	l.started = true
+	if l.sep == "\n" {
+		// End newline-separated lines right away, so that whoever reads them
+		// line by line sees each one as soon as it is written.
+		line += "\n"
+		l.started = false
+	}
+	_, err := io.WriteString(l.w, line)
+	return err
+}
+
+// finish terminates the output with a newline, unless nothing was written.
+func (l *lineWriter) finish() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.started {
+		return nil
+	}
+	l.started = false
+	_, err := io.WriteString(l.w, "\n")
+	return err
+}
+
+// writeGreetings writes the messages to lw in order opts.count times over, or
+// the greetings for the names in opts.input, and returns the number of lines
+// written, calling afterLine, if non-nil, after each one. With more than one
+// worker the iterations are split between goroutines and the order of lines
+// across them is not deterministic.
+func writeGreetings(ctx context.Context, lw *lineWriter, opts options, afterLine func() error) (int, error) {
+	if opts.input != nil {
+		return writeStdinGreetings(ctx, lw, opts, afterLine)
+	}
+	if opts.workers <= 1 {
+		if afterLine == nil && opts.plain() {
+			return writePlain(ctx, lw, opts.messages[0], opts.count)
+		}
+		return writeIterations(ctx, lw, opts, afterLine, 0, opts.iterations())
+	}
+	type result struct {
+		printed int
+		err     error
+	}
+	results := make(chan result, opts.workers)
+	var wg sync.WaitGroup
+	first := 0
+	for i := 0; i < opts.workers; i++ {
+		n := opts.iterations() / opts.workers
+		if i < opts.iterations()%opts.workers {
+			n++
+		}
+		wg.Add(1)
+		go func(first, n int) {
+			defer wg.Done()
+			printed, err := writeIterations(ctx, lw, opts, afterLine, first, n)
+			results <- result{printed, err}
+		}(first, n)
+		first += n
+	}
+	wg.Wait()
+	close(results)
+	var printed int
+	var err error
+	for r := range results {
+		printed += r.printed
+		if err == nil {
+			err = r.err
+		}
+	}
+	return printed, err
+}
+
+// plainChunk is how many lines writePlain writes between checks of its context.
+const plainChunk = 1024
+
+// writePlain writes msg to lw n times over using libA.GreetN, and returns the
+// number of lines written, stopping with ctx.Err() once ctx is done. lw's
+// separator must be a newline.
+func writePlain(ctx context.Context, lw *lineWriter, msg string, n int) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	// GreetN ends each line with the newline lw would otherwise put before the
+	// next one, so end any line lw left open and leave none open afterwards.
+	if lw.started {
+		if _, err := io.WriteString(lw.w, lw.sep); err != nil {
+			return 0, err
+		}
+		lw.started = false
+	}
+	printed := 0
+	for printed < n {
+		if err := ctx.Err(); err != nil {
+			return printed, err
+		}
+		chunk := n - printed
+		if chunk > plainChunk {
+			chunk = plainChunk
+		}
+		if err := libA.GreetN(lw.w, chunk, msg); err != nil {
+			return printed, err
+		}
+		printed += chunk
+	}
+	return printed, nil
+}
+
+// writeStdinGreetings writes the greeting for each name in opts.input to lw
+// opts.count times in a row as soon as it is read, sleeping for opts.delay
+// between lines. It returns the number of lines written, calling afterLine, if
+// non-nil, after each one and stopping with ctx.Err() once ctx is done.
+func writeStdinGreetings(ctx context.Context, lw *lineWriter, opts options, afterLine func() error) (int, error) {
+	printed := 0
+	err := eachStdinGreeting(ctx, opts.input, opts.log, func(greeting string) error {
+		for i := 0; i < opts.count; i++ {
+			if printed > 0 && opts.delay > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(opts.delay):
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := lw.writeLine(opts.decorate(opts.repeated(greeting))); err != nil {
+				return err
+			}
+			printed++
+			if afterLine != nil {
+				if err := afterLine(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return printed, err
+}
+
+// writeIterations writes the messages for the n iterations starting at first
+// to lw, sleeping for opts.delay between each line but not after the last. It
+// returns the number of lines written, calling afterLine, if non-nil, after
+// each one and stopping with ctx.Err() once ctx is done.
+func writeIterations(ctx context.Context, lw *lineWriter, opts options, afterLine func() error, first, n int) (int, error) {
+	printed := 0
+	for i := first; i < first+n; i++ {
+		msgs, err := opts.iteration(i)
+		if err != nil {
+			return printed, err
+		}
+		for j, msg := range msgs {
+			if (i > first || j > 0) && opts.delay > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(opts.delay):
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				return printed, err
+			}
+			if err := lw.writeLine(opts.decorate(msg)); err != nil {
+				return printed, err
+			}
+			printed++
+			if afterLine != nil {
+				if err := afterLine(); err != nil {
+					return printed, err
+				}
+			}
+		}
+	}
+	return printed, nil
+}
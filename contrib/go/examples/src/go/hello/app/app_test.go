@@ -0,0 +1,668 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+)
+
+// TestMain clears the environment variables hello falls back to, so that any
+// set in the developer's shell don't leak into the tests.
+func TestMain(m *testing.M) {
+	os.Unsetenv("HELLO_MESSAGE")
+	os.Unsetenv("HELLO_COUNT")
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+	out := filepath.Join(t.TempDir(), "out.txt")
+	for _, tc := range []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		// stderr, if set, must appear in what is written to stderr.
+		stderr string
+		// file, if set, is what -out must write to out.
+		file string
+	}{
+		{args: []string{"-n", "2", "-message", "hi", "-quiet"}, stdout: "hi\nhi\n"},
+		{args: []string{"-n", "2", "-message", "hi", "-quiet", "-out", out}, file: "hi\nhi\n"},
+		{args: []string{"-n", "-1", "-message", "hi", "-quiet"}, stdin: "2\n", stdout: "hi\nhi\n"},
+		{args: []string{"-n", "-1"}, stdin: "-3\n", code: 2, stderr: "count from stdin must be non-negative, got -3\n"},
+		{args: []string{"-n", "2", "-message", "hi", "-format", "json"}, stdout: `["hi","hi","Hello from libA!","Bye from libA!"]` + "\n"},
+		{args: []string{"-message", "hi", "-name", "Bo", "-uppercase"}, stdout: "HI\nHELLO, BO!\n"},
+		{args: []string{"-n", "0", "-require-output"}, code: 2, stderr: "message count is 0 but -require-output is set\n"},
+		{args: []string{"-version"}, stdout: fmt.Sprintf("hello %s (%s)\n", Version, runtime.Version())},
+		{args: []string{"-version", "-log-level", "loud", "-config", "missing.json"}, stdout: fmt.Sprintf("hello %s (%s)\n", Version, runtime.Version())},
+		{args: []string{"-message", "hi", "-name", "Bo", "-prefix", "x"}, stdout: "x hi\nx Hello, Bo!\n"},
+		{args: []string{"-n", "3", "-message", "hi", "-workers", "3", "-quiet"}, stdout: "hi\nhi\nhi\n"},
+		{args: []string{"-n", "2", "-message", "hi", "-summary", "-quiet"}, stdout: "hi\nhi\n", stderr: "Printed 2 greeting(s).\n"},
+		{args: []string{"-template", "{{.Index", "-quiet"}, code: 2, stderr: "unclosed action"},
+		{args: []string{"-message", "hi", "-name", "Bo", "-stderr"}, stderr: "hi\nHello, Bo!\n"},
+		{args: []string{"-n", "2", "-template", "{{.Index}}", "-count-from", "5", "-quiet"}, stdout: "5\n6\n"},
+		{args: []string{"-message", "hi", "-timestamp", "-time-format", "T", "-quiet"}, stdout: "T hi\n"},
+		{args: []string{"-message", "hi", "-log-level", "info", "-quiet"}, stdout: "hi\n", stderr: `msg="loop complete" printed=1`},
+		{args: []string{"-log-level", "loud"}, code: 2, stderr: `unknown log level "loud"`},
+	} {
+		stdin = strings.NewReader(tc.stdin)
+		var stdout, stderr bytes.Buffer
+		if code := Run(tc.args, &stdout, &stderr); code != tc.code {
+			t.Fatalf("args=%q: got exit code: %d, expected: %d (stderr: %q)", tc.args, code, tc.code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.stdout {
+			t.Fatalf("args=%q: got: %q, expected: %q", tc.args, got, tc.stdout)
+		}
+		if !strings.Contains(stderr.String(), tc.stderr) {
+			t.Fatalf("args=%q: got: %q, expected it to contain %q", tc.args, stderr.String(), tc.stderr)
+		}
+		if tc.file != "" {
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(data); got != tc.file {
+				t.Fatalf("args=%q: got: %q, expected: %q", tc.args, got, tc.file)
+			}
+		}
+	}
+}
+
+func TestRunFail(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-fail", "3", "-message", "hi", "-quiet"}, &stdout, &stderr); code != 3 {
+		t.Fatalf("got exit code: %d, expected: 3", code)
+	}
+	if got, exp := stdout.String(), "hi\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestRunSpeech(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{[]string{"-name", "Bo"}, "Hello, Bo!\n"},
+		{[]string{"-greeting", "Hola"}, "Hola, world!\n"},
+		{[]string{"-greeting", "Hello"}, "Hello, world!\n"},
+		{[]string{"-greeting", "Hola", "-name", "Bo"}, "Hola, Bo!\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run(append(tc.args, "-n", "0"), &stdout, &stderr); code != 0 {
+			t.Fatalf("args=%q: got exit code: %d, expected: 0 (stderr: %q)", tc.args, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("args=%q: got: %q, expected: %q", tc.args, got, tc.exp)
+		}
+	}
+}
+
+func TestRunHelp(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-h"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0", code)
+	}
+	if stdout.Len() != 0 {
+		t.Fatalf("got: %q, expected no output", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Examples:\n  hello -n 3\n") {
+		t.Fatalf("got: %q, expected usage examples", stderr.String())
+	}
+}
+
+func TestRunInvalidFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-format", "xml"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("got exit code: %d, expected: 2", code)
+	}
+	if stdout.Len() != 0 {
+		t.Fatalf("got: %q, expected no output", stdout.String())
+	}
+}
+
+func TestRunRepeatMessage(t *testing.T) {
+	for _, tc := range []struct {
+		repeat string
+		exp    string
+	}{
+		{"0", "\n\n"},
+		{"3", "hi hi hi\nhi hi hi\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"-message", "hi", "-repeat-message", tc.repeat, "-n", "2", "-quiet"}, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("repeat=%s: got exit code: %d, expected: 0 (stderr: %q)", tc.repeat, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("repeat=%s: got: %q, expected: %q", tc.repeat, got, tc.exp)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-repeat-message", "-1"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("got exit code: %d, expected: 2", code)
+	}
+}
+
+func TestRunColor(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-message", "hi", "-color", "red", "-quiet"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	if got, exp := stdout.String(), "hi\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	stdout.Reset()
+	if code := Run([]string{"-message", "hi", "-color", "red", "-force-color", "-quiet"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	if got, exp := stdout.String(), "\x1b[31mhi\x1b[0m\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestRunMessageFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "messages.txt")
+	if err := os.WriteFile(path, []byte("a\n\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-message-file", path, "-n", "2", "-quiet"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	if got, exp := stdout.String(), "a\n\nb\na\n\nb\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+
+	missing := filepath.Join(dir, "missing.txt")
+	stderr.Reset()
+	if code := Run([]string{"-message-file", missing}, &stdout, &stderr); code == 0 {
+		t.Fatal("got exit code: 0, expected non-zero")
+	}
+	if !strings.Contains(stderr.String(), missing) {
+		t.Fatalf("got: %q, expected the path in the error", stderr.String())
+	}
+
+	if code := Run([]string{"-message-file", path, "-message", "hi"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("got exit code: %d, expected: 2", code)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{[]string{"-n", "1000"}, "would print 1000 line(s) of \"Hello, world!\" and 1 libA greeting\n"},
+		{[]string{"-n", "2", "-quiet"}, "would print 2 line(s) of \"Hello, world!\"\n"},
+		{[]string{"-n", "3", "-template", "{{.Index}}", "-quiet"}, "would print 3 line(s) of template \"{{.Index}}\"\n"},
+		{[]string{"-n", "2", "-names", "a,b"}, "would print 2 line(s) of \"Hello, world!\" and 4 name greeting(s)\n"},
+		{[]string{"-message-file", empty}, "would print 0 line(s) and 1 libA greeting\n"},
+		{[]string{"-n", "9223372036854775807", "-names", "a,b"}, "would print 9223372036854775807 line(s) of \"Hello, world!\" and more than 9223372036854775807 name greeting(s)\n"},
+		{[]string{"-n", "9223372036854775807", "-message", "a", "-message", "b", "-quiet"}, "would print more than 9223372036854775807 line(s) of \"a\", \"b\"\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run(append(tc.args, "-dry-run"), &stdout, &stderr); code != 0 {
+			t.Fatalf("args=%q: got exit code: %d, expected: 0", tc.args, code)
+		}
+		if stdout.Len() != 0 {
+			t.Fatalf("args=%q: got: %q, expected no output", tc.args, stdout.String())
+		}
+		if got := stderr.String(); got != tc.exp {
+			t.Fatalf("args=%q: got: %q, expected: %q", tc.args, got, tc.exp)
+		}
+	}
+}
+
+func TestRunMaxRuntime(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-n", "100", "-delay", "20ms", "-max-runtime", "50ms", "-quiet"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	lines := strings.Count(stdout.String(), "\n")
+	if lines == 0 || lines >= 100 {
+		t.Fatalf("got %d lines, expected the run to be cut short", lines)
+	}
+	if !strings.Contains(stderr.String(), "max runtime reached") {
+		t.Fatalf("got: %q, expected a max runtime report", stderr.String())
+	}
+}
+
+func TestRunEnvironment(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		env  map[string]string
+		exp  string
+	}{
+		{nil, nil, "Hello, world!\n"},
+		{nil, map[string]string{"HELLO_MESSAGE": "env"}, "env\n"},
+		{[]string{"-message", "flag"}, map[string]string{"HELLO_MESSAGE": "env"}, "flag\n"},
+		{nil, map[string]string{"HELLO_COUNT": "2"}, "Hello, world!\nHello, world!\n"},
+		{[]string{"-n", "1"}, map[string]string{"HELLO_COUNT": "2"}, "Hello, world!\n"},
+	} {
+		t.Run(fmt.Sprintf("%q %v", tc.args, tc.env), func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			var stdout, stderr bytes.Buffer
+			if code := Run(append(tc.args, "-quiet"), &stdout, &stderr); code != 0 {
+				t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+			}
+			if got := stdout.String(); got != tc.exp {
+				t.Fatalf("got: %q, expected: %q", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestRunSeparator(t *testing.T) {
+	for _, tc := range []struct {
+		sep string
+		exp string
+	}{
+		{`,\t`, "hi,\thi,\thi\n"},
+		{`"`, "hi\"hi\"hi\n"},
+		{`\"`, "hi\"hi\"hi\n"},
+		{`\`, "hi\\hi\\hi\n"},
+		{`\x00`, "hi\x00hi\x00hi\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run([]string{"-n", "3", "-message", "hi", "-separator", tc.sep, "-quiet"}, &stdout, &stderr); code != 0 {
+			t.Fatalf("sep=%q: got exit code: %d, expected: 0 (stderr: %q)", tc.sep, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("sep=%q: got: %q, expected: %q", tc.sep, got, tc.exp)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-separator", `\q`}, &stdout, &stderr); code != 2 {
+		t.Fatalf("got exit code: %d, expected: 2", code)
+	}
+}
+
+func TestRunReverse(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-n", "3", "-template", "{{.Index}}", "-reverse", "-name", "Bo"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	got, exp := stdout.String(), "3\n2\n1\nHello, Bo!\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+// failWriter is an io.Writer whose writes always fail.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRunBuffered(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-n", "3", "-buffered", "-quiet"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	if got, exp := stdout.String(), strings.Repeat("Hello, world!\n", 3); got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+
+	stderr.Reset()
+	if code := Run([]string{"-n", "3", "-buffered", "-quiet"}, failWriter{}, &stderr); code != 1 {
+		t.Fatalf("got exit code: %d, expected: 1", code)
+	}
+	if !strings.Contains(stderr.String(), "write failed") {
+		t.Fatalf("got: %q, expected the flush error", stderr.String())
+	}
+}
+
+func TestWriteJSONCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	// Nothing may be allocated up front for the count, however large it is.
+	printed, err := writeJSON(ctx, &buf, options{messages: []string{"hi"}, count: math.MaxInt, repeat: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got: %v, expected: %v", err, context.Canceled)
+	}
+	if printed != 0 {
+		t.Fatalf("got: %d, expected: 0", printed)
+	}
+	if got, exp := buf.String(), "[]\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestCountingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	cw := &countingWriter{w: &buf}
+	cw.Write([]byte("abc"))
+	cw.Write([]byte("de"))
+	if got, exp := cw.Written(), int64(5); got != exp {
+		t.Fatalf("got: %d, expected: %d", got, exp)
+	}
+}
+
+func TestRunCountBytes(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-message", "hi", "-n", "2", "-prefix", "x", "-name", "Bo", "-count-bytes"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	exp := fmt.Sprintf("wrote %d bytes\n", stdout.Len())
+	if got := stderr.String(); got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestRunNames(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{[]string{"-names", "a,b"}, "Hello, a!\nHello, b!\nHello, a!\nHello, b!\n"},
+		{[]string{"-names", "a,b", "-per-name"}, "Hello, a!\nHello, a!\nHello, b!\nHello, b!\n"},
+		{[]string{"-names", "a"}, "Hello, a!\nHello, a!\n"},
+		{[]string{"-names", "a", "-per-name"}, "Hello, a!\nHello, a!\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run(append(tc.args, "-n", "2", "-message-file", os.DevNull), &stdout, &stderr); code != 0 {
+			t.Fatalf("args=%q: got exit code: %d, expected: 0 (stderr: %q)", tc.args, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("args=%q: got: %q, expected: %q", tc.args, got, tc.exp)
+		}
+	}
+}
+
+func TestRunNamesStreamed(t *testing.T) {
+	// The name greetings are written as they are given, so a closed pipe stops
+	// even a speech far too long to build in memory.
+	stdout := &pipeWriter{writes: 2}
+	var stderr bytes.Buffer
+	if code := Run([]string{"-names", "a", "-n", "9223372036854775807", "-message-file", os.DevNull}, stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	if got, exp := stdout.buf.String(), "Hello, a!\nHello, a!\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+// pipeWriter is an io.Writer that accepts a number of writes and then fails as
+// if its reader had closed the pipe.
+type pipeWriter struct {
+	buf    bytes.Buffer
+	writes int
+}
+
+func (p *pipeWriter) Write(b []byte) (int, error) {
+	if p.writes == 0 {
+		return 0, &os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}
+	}
+	p.writes--
+	return p.buf.Write(b)
+}
+
+func TestRunBrokenPipe(t *testing.T) {
+	stdout := &pipeWriter{writes: 2}
+	var stderr bytes.Buffer
+	if code := Run([]string{"-n", "100", "-quiet"}, stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0", code)
+	}
+	if got, exp := stdout.buf.String(), "Hello, world!\nHello, world!\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("got: %q, expected no error output", stderr.String())
+	}
+
+	stderr.Reset()
+	if code := Run([]string{"-n", "100", "-quiet"}, failWriter{}, &stderr); code != 1 {
+		t.Fatalf("got exit code: %d, expected: 1", code)
+	}
+	if !strings.Contains(stderr.String(), "write failed") {
+		t.Fatalf("got: %q, expected the write error", stderr.String())
+	}
+}
+
+func TestRunSpeakEvery(t *testing.T) {
+	for _, tc := range []struct {
+		n   string
+		exp string
+	}{
+		{"4", "hi\nhi\nHello, Bo!\nhi\nhi\nHello, Bo!\n"},
+		{"3", "hi\nhi\nHello, Bo!\nhi\nHello, Bo!\n"},
+		{"0", "Hello, Bo!\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"-n", tc.n, "-message", "hi", "-name", "Bo", "-speak-every", "2"}, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("n=%s: got exit code: %d, expected: 0 (stderr: %q)", tc.n, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("n=%s: got: %q, expected: %q", tc.n, got, tc.exp)
+		}
+	}
+
+	// Each speech greets the names once, not n times over.
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-n", "4", "-message", "hi", "-names", "a,b", "-speak-every", "2"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	got, exp := stdout.String(), "hi\nhi\nHello, a!\nHello, b!\nhi\nhi\nHello, a!\nHello, b!\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestRunSpeakEveryOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-n", "2", "-message", "hi", "-name", "Bo", "-speak-every", "1", "-out", path}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := string(data), "hi\nHello, Bo!\nhi\nHello, Bo!\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	if got := stdout.String(); got != "" {
+		t.Fatalf("got: %q, expected nothing on stdout", got)
+	}
+}
+
+func TestRunFromStdin(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader("Ann\n\n Bo \n")
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"-from-stdin", "-n", "2", "-quiet", "-log-level", "debug"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	got, exp := stdout.String(), "Hello, Ann!\nHello, Ann!\nHello, Bo!\nHello, Bo!\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	if !strings.Contains(stderr.String(), "skipping empty stdin line") {
+		t.Fatalf("got: %q, expected the blank line to be logged", stderr.String())
+	}
+
+	stdin = iotest.ErrReader(errors.New("read failed"))
+	stderr.Reset()
+	if code := Run([]string{"-from-stdin"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("got exit code: %d, expected: 1", code)
+	}
+}
+
+// chanWriter is an io.Writer that sends each write to the channel.
+type chanWriter chan string
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	c <- string(p)
+	return len(p), nil
+}
+
+func TestRunFromStdinStreams(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+	r, w := io.Pipe()
+	stdin = r
+	writes := make(chan string)
+	code := make(chan int)
+	go func() {
+		var stderr bytes.Buffer
+		code <- Run([]string{"-from-stdin", "-quiet"}, chanWriter(writes), &stderr)
+	}()
+	// Each greeting must be written before the next name is read.
+	for _, tc := range []struct {
+		name, exp string
+	}{
+		{"Ann", "Hello, Ann!\n"},
+		{"Bo", "Hello, Bo!\n"},
+	} {
+		fmt.Fprintln(w, tc.name)
+		if got := <-writes; got != tc.exp {
+			t.Fatalf("got: %q, expected: %q", got, tc.exp)
+		}
+	}
+	w.Close()
+	if got := <-code; got != 0 {
+		t.Fatalf("got exit code: %d, expected: 0", got)
+	}
+}
+
+func TestRunFromStdinMaxRuntime(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+	for _, tc := range []struct {
+		format string
+		exp    string
+	}{
+		{"text", ""},
+		{"json", "[]\n"},
+	} {
+		// Waiting for a line that never comes must not outlast -max-runtime.
+		r, w := io.Pipe()
+		stdin = r
+		var stdout, stderr bytes.Buffer
+		code := Run([]string{"-from-stdin", "-format", tc.format, "-max-runtime", "50ms", "-quiet"}, &stdout, &stderr)
+		w.Close()
+		if code != 0 {
+			t.Fatalf("format=%s: got exit code: %d, expected: 0 (stderr: %q)", tc.format, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("format=%s: got: %q, expected: %q", tc.format, got, tc.exp)
+		}
+		if got, exp := stderr.String(), "max runtime reached after 0 line(s)\n"; got != exp {
+			t.Fatalf("format=%s: got: %q, expected: %q", tc.format, got, exp)
+		}
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	config := write("config.json", `{"message": ["a", "b"], "n": 2, "prefix": "x", "quiet": true}`)
+
+	for _, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{nil, "x a\nx b\nx a\nx b\n"},
+		{[]string{"-n", "1", "-message", "c"}, "x c\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run(append(tc.args, "-config", config), &stdout, &stderr); code != 0 {
+			t.Fatalf("args=%q: got exit code: %d, expected: 0 (stderr: %q)", tc.args, code, stderr.String())
+		}
+		if got := stdout.String(); got != tc.exp {
+			t.Fatalf("args=%q: got: %q, expected: %q", tc.args, got, tc.exp)
+		}
+	}
+
+	for _, tc := range []struct {
+		contents string
+		errText  string
+	}{
+		{`{"bogus": 1}`, `unknown key "bogus"`},
+		{`{"n": `, "parsing config"},
+		{`{"workers": "x"}`, `invalid value for "workers"`},
+		{`{"n": 2, "quiet": true} {"oops"`, "unexpected data after the top-level object"},
+		{`{"n": [1, 3]}`, `"n" does not take a list`},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := Run([]string{"-config", write("bad.json", tc.contents)}, &stdout, &stderr); code != 2 {
+			t.Fatalf("config=%s: got exit code: %d, expected: 2", tc.contents, code)
+		}
+		if !strings.Contains(stderr.String(), tc.errText) {
+			t.Fatalf("config=%s: got: %q, expected it to contain %q", tc.contents, stderr.String(), tc.errText)
+		}
+	}
+}
+
+func TestRunCountRange(t *testing.T) {
+	run := func(args ...string) (string, int) {
+		var stdout, stderr bytes.Buffer
+		code := Run(append(args, "-quiet"), &stdout, &stderr)
+		return stdout.String(), code
+	}
+	first, code := run("-n", "2-50", "-seed", "42")
+	if code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0", code)
+	}
+	lines := strings.Count(first, "\n")
+	if lines < 2 || lines > 50 {
+		t.Fatalf("got %d lines, expected between 2 and 50", lines)
+	}
+	if again, _ := run("-n", "2-50", "-seed", "42"); again != first {
+		t.Fatalf("got %d lines, expected the same seed to give %d", strings.Count(again, "\n"), lines)
+	}
+	for _, n := range []string{"5-2", "0-9223372036854775807"} {
+		if _, code := run("-n", n); code != 2 {
+			t.Fatalf("n=%s: got exit code: %d, expected: 2", n, code)
+		}
+	}
+}
+
+func TestRunMaxRuntimeEndsLine(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-n", "100", "-delay", "30ms", "-max-runtime", "100ms", "-quiet"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("got exit code: %d, expected: 0 (stderr: %q)", code, stderr.String())
+	}
+	lines := strings.Count(stdout.String(), "\n")
+	if lines == 0 {
+		t.Fatal("expected some lines before the max runtime")
+	}
+	if got, exp := stdout.String(), strings.Repeat("Hello, world!\n", lines); got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	if got, exp := stderr.String(), fmt.Sprintf("max runtime reached after %d line(s)\n", lines); got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
@@ -1,16 +1,16 @@
 package main
 
 import (
-	"flag"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"libA"
+	"hello/app"
 )
 
 func main() {
-	n := flag.Int("n", 1, "print message n times")
-	flag.Parse()
-	for i := 0; i < *n; i++ {
-		println("Hello, world!")
-	}
-	libA.Speak()
+	// Have writes to a closed pipe fail with EPIPE, which app.Run handles, rather
+	// than killing the process.
+	signal.Ignore(syscall.SIGPIPE)
+	os.Exit(app.Run(os.Args[1:], os.Stdout, os.Stderr))
 }
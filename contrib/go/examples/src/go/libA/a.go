@@ -1,15 +1,213 @@
 package libA
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
 	"libB"
 	"libC"
 )
 
-func Speak() {
-	println("Hello from libA!")
+// greeting is the line libA opens its speech with.
+const greeting = "Hello from libA!"
+
+// Greeting returns the line libA opens its speech with.
+func Greeting() string {
+	return greeting
+}
+
+// Stats returns the number of space-separated words in, and the length in
+// bytes of, libA's greeting.
+func Stats() (wordCount int, byteLen int) {
+	inWord := false
+	for i := 0; i < len(greeting); i++ {
+		if greeting[i] == ' ' {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			wordCount++
+		}
+	}
+	return wordCount, len(greeting)
+}
+
+// Speak writes libA's greeting to w, along with the speeches of the libraries
+// it depends on.
+func Speak(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, Greeting()); err != nil {
+		return err
+	}
 	libB.Speak()
 	libC.Speak()
-	println("Bye from libA!")
+	_, err := fmt.Fprintln(w, "Bye from libA!")
+	return err
+}
+
+// MustSpeak is like Speak but panics if the speech cannot be written.
+func MustSpeak(w io.Writer) {
+	if err := Speak(w); err != nil {
+		panic("libA: Speak failed: " + err.Error())
+	}
+}
+
+// SpeakN writes libA's greeting to w n times; it writes nothing if n <= 0.
+func SpeakN(w io.Writer, n int) error {
+	return SpeakNContext(context.Background(), w, n)
+}
+
+// SpeakNContext is like SpeakN, but stops early and returns ctx.Err() once ctx
+// is done.
+func SpeakNContext(ctx context.Context, w io.Writer, n int) error {
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, Greeting()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpeakWord writes a greeting to the world to w, opening with word in place of
+// "Hello".
+func SpeakWord(w io.Writer, word string) error {
+	_, err := fmt.Fprintf(w, "%s, world!\n", word)
+	return err
+}
+
+// GreetN writes msg to w as a line n times over; it writes nothing if n <= 0.
+// It allocates once up front, however large n is.
+func GreetN(w io.Writer, n int, msg string) error {
+	if n <= 0 {
+		return nil
+	}
+	line := make([]byte, len(msg)+1)
+	copy(line, msg)
+	line[len(msg)] = '\n'
+	for i := 0; i < n; i++ {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpeakTimes returns libA's greeting n times over, as SpeakN would write it.
+// The result is empty, but never nil, if n <= 0.
+func SpeakTimes(n int) []string {
+	if n < 0 {
+		n = 0
+	}
+	greetings := make([]string, n)
+	for i := range greetings {
+		greetings[i] = Greeting()
+	}
+	return greetings
+}
+
+// SpeakTo writes a greeting for name to w, ignoring any surrounding whitespace.
+func SpeakTo(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "Hello, %s!\n", strings.TrimSpace(name))
+	return err
+}
+
+// A Greeter writes a greeting to w.
+type Greeter interface {
+	Greet(w io.Writer) error
+}
+
+// GreeterFunc adapts an ordinary function to the Greeter interface.
+type GreeterFunc func(w io.Writer) error
+
+// Greet calls f(w).
+func (f GreeterFunc) Greet(w io.Writer) error {
+	return f(w)
+}
+
+// DefaultGreeter is the name the built-in Speak greeter is registered under.
+const DefaultGreeter = "default"
+
+var (
+	greetersMu sync.RWMutex
+	greeters   = map[string]Greeter{DefaultGreeter: GreeterFunc(Speak)}
+)
+
+// Register makes g available under name. It panics if g is nil or if name is
+// already registered.
+func Register(name string, g Greeter) {
+	greetersMu.Lock()
+	defer greetersMu.Unlock()
+	if g == nil {
+		panic("libA: Register greeter is nil")
+	}
+	if _, dup := greeters[name]; dup {
+		panic("libA: Register called twice for greeter " + name)
+	}
+	greeters[name] = g
+}
+
+// Greeters returns the sorted names of the registered greeters.
+func Greeters() []string {
+	greetersMu.RLock()
+	defer greetersMu.RUnlock()
+	names := make([]string, 0, len(greeters))
+	for name := range greeters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the greeter registered under name.
+func Lookup(name string) (Greeter, error) {
+	greetersMu.RLock()
+	g, ok := greeters[name]
+	greetersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown greeter %q (available: %s)", name, strings.Join(Greeters(), ", "))
+	}
+	return g, nil
+}
+
+// Config groups the options for a customized greeting.
+type Config struct {
+	// Word opens the greeting, in place of "Hello".
+	Word string
+	// Name is who is greeted; surrounding whitespace is ignored.
+	Name string
+	// Writer receives the greeting; if nil, it is written to os.Stdout.
+	Writer io.Writer
+}
+
+// DefaultConfig returns a Config that greets the world on stdout.
+func DefaultConfig() Config {
+	return Config{Word: "Hello", Name: "world", Writer: os.Stdout}
+}
+
+// Speak writes the greeting described by c to c.Writer.
+func (c Config) Speak() error {
+	w := c.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	_, err := fmt.Fprintf(w, "%s, %s!\n", c.Word, strings.TrimSpace(c.Name))
+	return err
+}
+
+// SpeakAll writes a greeting for each of names to w, in order.
+func SpeakAll(w io.Writer, names []string) error {
+	for _, name := range names {
+		if err := SpeakTo(w, name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func Add(a int, b int) int {
@@ -1,6 +1,12 @@
 package libA
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -10,3 +16,209 @@ func TestAdd(t *testing.T) {
 		t.Fatalf("got: %d, expected: %d", got, exp)
 	}
 }
+
+// failWriter is an io.Writer whose writes always fail.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestMustSpeak(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected MustSpeak to panic")
+		}
+		if msg, ok := r.(string); !ok || !strings.Contains(msg, "write failed") {
+			t.Fatalf("got panic: %v, expected it to describe the write error", r)
+		}
+	}()
+	MustSpeak(failWriter{})
+}
+
+func TestGreeting(t *testing.T) {
+	got, exp := Greeting(), "Hello from libA!"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestStats(t *testing.T) {
+	words, size := Stats()
+	if exp := len(strings.Fields(greeting)); words != exp {
+		t.Fatalf("got: %d words, expected: %d", words, exp)
+	}
+	if exp := len(greeting); size != exp {
+		t.Fatalf("got: %d bytes, expected: %d", size, exp)
+	}
+}
+
+func TestSpeak(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Speak(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, exp := buf.String(), "Hello from libA!\nBye from libA!\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestSpeakN(t *testing.T) {
+	for _, tc := range []struct {
+		n   int
+		exp string
+	}{
+		{-1, ""},
+		{0, ""},
+		{2, "Hello from libA!\nHello from libA!\n"},
+	} {
+		var buf bytes.Buffer
+		if err := SpeakN(&buf, tc.n); err != nil {
+			t.Fatalf("n=%d: unexpected error: %v", tc.n, err)
+		}
+		if got := buf.String(); got != tc.exp {
+			t.Fatalf("n=%d: got: %q, expected: %q", tc.n, got, tc.exp)
+		}
+	}
+}
+
+func TestSpeakWord(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SpeakWord(&buf, "Hola"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, exp := buf.String(), "Hola, world!\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestGreetN(t *testing.T) {
+	var buf bytes.Buffer
+	if err := GreetN(&buf, 2, "hi"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := GreetN(&buf, 0, "ignored"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, exp := buf.String(), "hi\nhi\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	if err := GreetN(failWriter{}, 1, "hi"); err == nil {
+		t.Fatal("expected the write error to be returned")
+	}
+}
+
+func BenchmarkGreetN(b *testing.B) {
+	b.ReportAllocs()
+	if err := GreetN(io.Discard, b.N, "Hello, world!"); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestSpeakTimes(t *testing.T) {
+	if got := SpeakTimes(-1); got == nil || len(got) != 0 {
+		t.Fatalf("got: %#v, expected an empty non-nil slice", got)
+	}
+	got := SpeakTimes(2)
+	if len(got) != 2 || got[0] != Greeting() || got[1] != Greeting() {
+		t.Fatalf("got: %q, expected the greeting twice", got)
+	}
+}
+
+func TestSpeakNContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	if err := SpeakNContext(ctx, &buf, 3); err != context.Canceled {
+		t.Fatalf("got: %v, expected: %v", err, context.Canceled)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("got: %q, expected no output", buf.String())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		greetersMu.Lock()
+		delete(greeters, "test")
+		greetersMu.Unlock()
+	}()
+	Register("test", GreeterFunc(func(w io.Writer) error {
+		_, err := io.WriteString(w, "hi\n")
+		return err
+	}))
+	g, err := Lookup("test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := g.Greet(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, exp := buf.String(), "hi\n"; got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+	if _, err := Lookup("missing"); err == nil || !strings.Contains(err.Error(), "default, test") {
+		t.Fatalf("got: %v, expected an error listing the available greeters", err)
+	}
+}
+
+func TestConfigSpeakZeroValue(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+	os.Stdout = w
+	err = Config{Word: "Hi", Name: "x"}.Speak()
+	w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "Hi, x!\n"; string(got) != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
+
+func TestSpeakAll(t *testing.T) {
+	for _, tc := range []struct {
+		names []string
+		exp   string
+	}{
+		{nil, ""},
+		{[]string{"Ann", " Bo ", "Ann"}, "Hello, Ann!\nHello, Bo!\nHello, Ann!\n"},
+	} {
+		var buf bytes.Buffer
+		if err := SpeakAll(&buf, tc.names); err != nil {
+			t.Fatalf("names=%q: unexpected error: %v", tc.names, err)
+		}
+		if got := buf.String(); got != tc.exp {
+			t.Fatalf("names=%q: got: %q, expected: %q", tc.names, got, tc.exp)
+		}
+	}
+}
+
+func TestConfigSpeak(t *testing.T) {
+	var buf bytes.Buffer
+	c := DefaultConfig()
+	c.Writer = &buf
+	if err := c.Speak(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Word, c.Name = "Bonjour", " Marie "
+	if err := c.Speak(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, exp := buf.String(), "Hello, world!\nBonjour, Marie!\n"
+	if got != exp {
+		t.Fatalf("got: %q, expected: %q", got, exp)
+	}
+}
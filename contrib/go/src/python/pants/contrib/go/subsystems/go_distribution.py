@@ -35,7 +35,7 @@ class GoDistribution(NativeTool):
 
   options_scope = 'go-distribution'
   name = 'go'
-  default_version = '1.8.3'
+  default_version = '1.21.13'
   archive_type = 'tgz'
 
   def get_external_url_generator(self):
@@ -59,7 +59,9 @@ class GoDistribution(NativeTool):
     # set the GOPATH here to a valid value that nonetheless will fail to work if GOPATH is
     # actually used by the subcommand.
     no_gopath = os.devnull
-    return OrderedDict(GOROOT=self.goroot, GOPATH=gopath or no_gopath)
+    # NB: As of go 1.16, module-aware mode is the default; pants lays out a classic GOPATH
+    # workspace instead, so we turn modules off.
+    return OrderedDict(GOROOT=self.goroot, GOPATH=gopath or no_gopath, GO111MODULE='off')
 
   class GoCommand(namedtuple('GoCommand', ['cmdline', 'env'])):
     """Encapsulates a go command that can be executed."""
@@ -20,10 +20,9 @@ class GoDistributionTest(unittest.TestCase):
 
   @staticmethod
   def _generate_go_command_regex(gopath, final_value):
-    goroot_env = r'GOROOT=[^ ]+'
-    gopath_env = r'GOPATH={}'.format(gopath)
     # order of env values varies by interpreter and platform
-    env_values = r'({goroot_env} {gopath_env}|{gopath_env} {goroot_env})'.format(goroot_env=goroot_env, gopath_env=gopath_env)
+    env_value = r'(GOROOT=[^ ]+|GOPATH={}|GO111MODULE=off)'.format(gopath)
+    env_values = r'{env_value} {env_value} {env_value}'.format(env_value=env_value)
     return r'^{env_values} .*/go env {final_value}$'.format(env_values=env_values, final_value=final_value)
 
   def distribution(self):
@@ -75,7 +74,8 @@ class GoDistributionTest(unittest.TestCase):
     go_cmd = go_distribution.create_go_cmd(cmd='env', gopath='/tmp/fred', args=['GOROOT'])
 
     self.assertEqual({'GOROOT': go_distribution.goroot,
-                      'GOPATH': '/tmp/fred'}, go_cmd.env)
+                      'GOPATH': '/tmp/fred',
+                      'GO111MODULE': 'off'}, go_cmd.env)
     self.assertEqual('go', os.path.basename(go_cmd.cmdline[0]))
     self.assertEqual(['env', 'GOROOT'], go_cmd.cmdline[1:])
 